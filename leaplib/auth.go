@@ -0,0 +1,43 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+// Permissions describes what a subscribed client is allowed to do with a
+// document once it has been authenticated.
+type Permissions int
+
+// The permission levels a client can hold. PermReadWrite is implied whenever
+// no Authenticator is configured on a Binder, preserving the behaviour of
+// the plain Subscribe call.
+const (
+	PermReadOnly Permissions = iota
+	PermReadWrite
+)
+
+// Authenticator verifies a client-supplied token, returning the id of the
+// user it belongs to and the permissions they hold against the document
+// identified by docID. An error is returned if the token is missing,
+// malformed, expired, or otherwise not acceptable.
+type Authenticator interface {
+	Verify(token string, docID string) (userID string, perms Permissions, err error)
+}
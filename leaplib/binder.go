@@ -0,0 +1,748 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// Errors that can be returned by a Binder or BinderPortal.
+var (
+	ErrTransformTimeout = errors.New("transform request timed out")
+	ErrNonTextDocument  = errors.New("document content is not plain text")
+	ErrDeadlineExceeded = errors.New("portal deadline exceeded")
+	ErrVerifyOnly       = errors.New("portal only has read-only permissions")
+)
+
+// BinderError is sent down a Binder's error channel whenever something goes
+// wrong that the hosting service should know about (e.g. a failed flush to
+// the document store).
+type BinderError struct {
+	DocumentID string
+	Err        error
+}
+
+// BinderConfig holds configuration options for a Binder.
+type BinderConfig struct {
+	// FlushPeriod is the interval, in milliseconds, between automatic
+	// flushes of the document to its DocumentStore.
+	FlushPeriod int64 `json:"flush_period_ms"`
+
+	// ClientReadLimit caps, in bytes per second, how fast a client can be
+	// dispatched transforms. 0 means unlimited.
+	ClientReadLimit int64 `json:"client_read_limit"`
+
+	// ClientWriteLimit caps, in bytes per second, how fast a client can
+	// submit transforms. 0 means unlimited.
+	ClientWriteLimit int64 `json:"client_write_limit"`
+
+	// SampleWindow is the interval, in milliseconds, on which each
+	// client's transfer rate is sampled.
+	SampleWindow int64 `json:"sample_window_ms"`
+
+	// ClientStallTimeout is how long, in milliseconds, a client is
+	// allowed to have transforms waiting for delivery (because it left
+	// its TransformRcvChan undrained, or because it is over its
+	// ClientReadLimit) before it's considered stalled and disconnected.
+	ClientStallTimeout int64 `json:"client_stall_timeout_ms"`
+
+	// Tracer is the opentracing.Tracer used to instrument this binder.
+	// When nil, BindNew builds one from CollectorType and the fields
+	// below (a no-op tracer when CollectorType is empty); assign a Tracer
+	// directly to share one across several binders.
+	Tracer opentracing.Tracer `json:"-"`
+
+	// CollectorType selects the span exporter built for Tracer when it
+	// isn't set explicitly: "zipkin", "jaeger", or "" for a no-op tracer.
+	CollectorType string `json:"collector_type"`
+
+	// ConnectString is the exporter-specific endpoint, e.g. a Zipkin
+	// HTTP collector URL or a Jaeger agent host:port.
+	ConnectString string `json:"connect_string"`
+
+	// ServiceName identifies this leaps server in the resulting traces.
+	ServiceName string `json:"service_name"`
+
+	// SamplerRate is the fraction (0.0-1.0) of traces to sample.
+	SamplerRate float64 `json:"sampler_rate"`
+
+	// Authenticator, when set, is used by SubscribeAs to verify the token
+	// a client presents and resolve the permissions it subscribes with.
+	// Subscribe always grants PermReadWrite regardless of Authenticator,
+	// so leave this nil for deployments that don't need per-client auth.
+	Authenticator Authenticator `json:"-"`
+}
+
+// DefaultBinderConfig returns a BinderConfig populated with sane defaults.
+func DefaultBinderConfig() BinderConfig {
+	return BinderConfig{
+		FlushPeriod:        60000,
+		ClientReadLimit:    0,
+		ClientWriteLimit:   0,
+		SampleWindow:       100,
+		ClientStallTimeout: 1000,
+		ServiceName:        "leaps",
+		SamplerRate:        1.0,
+	}
+}
+
+// tracer returns the configured Tracer, building one from the collector
+// fields if none was set explicitly, and the io.Closer (if any) that should
+// be closed alongside the binder.
+func (c BinderConfig) tracer() (opentracing.Tracer, io.Closer, error) {
+	if c.Tracer != nil {
+		return c.Tracer, ioutil.NopCloser(nil), nil
+	}
+	return CreateTracer(TracingConfig{
+		CollectorType: c.CollectorType,
+		ConnectString: c.ConnectString,
+		ServiceName:   c.ServiceName,
+		SamplerRate:   c.SamplerRate,
+	})
+}
+
+// portalInternal is the binder-side handle for a subscribed client.
+type portalInternal struct {
+	ch           chan []interface{}
+	readLimiter  *limiter
+	writeLimiter *limiter
+	pendingSince time.Time
+
+	// pending holds transforms that broadcast has accepted but couldn't yet
+	// deliver, either because the portal's channel still held an
+	// undelivered batch or because it's over its ClientReadLimit. They are
+	// merged into the next batch sent down ch rather than dropped, so a
+	// client that's merely a little behind never silently loses a
+	// transform.
+	pending []OTransform
+}
+
+// close stops both of the portal's limiters (each owns a Monitor goroutine)
+// and closes its receive channel. Callers must remove pi from b.portals
+// themselves.
+func (pi *portalInternal) close() {
+	pi.readLimiter.Close()
+	pi.writeLimiter.Close()
+	close(pi.ch)
+}
+
+// subscribeRequest is submitted to a Binder's loop in order to register a
+// new client and obtain a BinderPortal to interact through.
+type subscribeRequest struct {
+	userID     string
+	perms      Permissions
+	resultChan chan *BinderPortal
+}
+
+// transformSubmission is submitted to a Binder's loop by a BinderPortal on
+// behalf of a client wishing to apply an OTransform.
+type transformSubmission struct {
+	portalID    string
+	transform   OTransform
+	versionChan chan int
+	errChan     chan error
+}
+
+// unsubscribeRequest asks a Binder's loop to drop a portal immediately,
+// without it being treated as a stalled/bad client.
+type unsubscribeRequest struct {
+	portalID string
+}
+
+// Binder is responsible for managing concurrent access to a single Document.
+// All reads and mutations of the document happen sequentially inside its
+// internal loop, which serialises subscriptions and incoming transforms and
+// fans each accepted transform back out to every subscribed portal.
+type Binder struct {
+	document *Document
+	store    DocumentStore
+	config   BinderConfig
+
+	errorChan chan<- BinderError
+	logger    *Logger
+
+	tracer       opentracing.Tracer
+	tracerCloser io.Closer
+	rootSpan     opentracing.Span
+
+	version int
+	history []OTransform
+
+	portals      map[string]*portalInternal
+	nextPortalID int
+
+	subscribeChan   chan subscribeRequest
+	transformChan   chan transformSubmission
+	unsubscribeChan chan unsubscribeRequest
+
+	closeChan  chan struct{}
+	closedChan chan struct{}
+}
+
+// BindNew binds a Binder to a Document, persisting it to store immediately
+// (or, if store already holds a document under the same id, binding to that
+// stored copy instead) and starting the binder's internal loop. Errors
+// encountered after this
+// call (e.g. failures to flush) are reported on errorChan rather than
+// returned.
+func BindNew(
+	doc *Document,
+	store DocumentStore,
+	config BinderConfig,
+	errorChan chan<- BinderError,
+	logger *Logger,
+) (*Binder, error) {
+	if doc == nil {
+		return nil, errors.New("cannot bind to a nil document")
+	}
+
+	tracer, tracerCloser, err := config.tracer()
+	if err != nil {
+		return nil, err
+	}
+
+	rootSpan := tracer.StartSpan(fmt.Sprintf("binder:%v", doc.ID))
+	rootSpan.SetTag("document.id", doc.ID)
+
+	// If the store already holds a document under this id (e.g. another
+	// server in the cluster was hosting it and crashed, or is handing it
+	// off via EtcdStore's lease expiry), resume from that copy rather than
+	// overwriting it, so transform versioning and history continue from
+	// where the previous holder left off instead of resetting to version 1.
+	if existing, err := store.Fetch(doc.ID); err == nil {
+		logger.Infof("resuming document %v from store at version %v", doc.ID, existing.Version)
+		doc = existing
+	} else if err == ErrDocumentNotExist {
+		if doc.Version == 0 {
+			doc.Version = 1
+		}
+		if err := store.Store(doc); err != nil {
+			rootSpan.SetTag("error", true)
+			rootSpan.Finish()
+			tracerCloser.Close()
+			return nil, err
+		}
+	} else {
+		rootSpan.SetTag("error", true)
+		rootSpan.Finish()
+		tracerCloser.Close()
+		return nil, err
+	}
+
+	b := &Binder{
+		document:        doc,
+		store:           store,
+		config:          config,
+		errorChan:       errorChan,
+		logger:          logger,
+		tracer:          tracer,
+		tracerCloser:    tracerCloser,
+		rootSpan:        rootSpan,
+		version:         doc.Version,
+		portals:         map[string]*portalInternal{},
+		subscribeChan:   make(chan subscribeRequest),
+		transformChan:   make(chan transformSubmission),
+		unsubscribeChan: make(chan unsubscribeRequest),
+		closeChan:       make(chan struct{}),
+		closedChan:      make(chan struct{}),
+	}
+
+	go b.loop()
+
+	return b, nil
+}
+
+// Subscribe registers a new client with the binder and returns a portal
+// through which that client can send transforms and receive the transforms
+// of others. It always grants PermReadWrite; use SubscribeAs for a portal
+// whose permissions are resolved from a token via the binder's
+// Authenticator.
+func (b *Binder) Subscribe() *BinderPortal {
+	portal := b.subscribe("", PermReadWrite)
+	return portal
+}
+
+// SubscribeAs verifies token against the binder's configured Authenticator
+// and, if accepted, registers a new client and returns a portal carrying
+// the resolved user id and permissions. If no Authenticator is configured
+// it behaves exactly like Subscribe, ignoring token.
+func (b *Binder) SubscribeAs(token string) (*BinderPortal, error) {
+	if b.config.Authenticator == nil {
+		return b.subscribe("", PermReadWrite), nil
+	}
+
+	userID, perms, err := b.config.Authenticator.Verify(token, b.document.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.subscribe(userID, perms), nil
+}
+
+func (b *Binder) subscribe(userID string, perms Permissions) *BinderPortal {
+	span := b.tracer.StartSpan("subscribe", opentracing.ChildOf(b.rootSpan.Context()))
+	defer span.Finish()
+
+	req := subscribeRequest{
+		userID:     userID,
+		perms:      perms,
+		resultChan: make(chan *BinderPortal),
+	}
+	b.subscribeChan <- req
+	portal := <-req.resultChan
+
+	span.SetTag("document.id", portal.Document.ID)
+	span.SetTag("portal.id", portal.ID)
+	if len(userID) > 0 {
+		span.SetTag("user.id", userID)
+	}
+
+	return portal
+}
+
+// SubscribeContext behaves like Subscribe, but also unsubscribes the
+// returned portal as soon as ctx is done: its TransformRcvChan is drained
+// and closed cleanly, without it being treated as a stalled/bad client.
+func (b *Binder) SubscribeContext(ctx context.Context) *BinderPortal {
+	portal := b.Subscribe()
+
+	go func() {
+		<-ctx.Done()
+		portal.unsubscribe()
+	}()
+
+	return portal
+}
+
+// Close shuts the binder down, flushing the document to its store and
+// closing every subscribed portal's TransformRcvChan.
+func (b *Binder) Close() {
+	close(b.closeChan)
+	<-b.closedChan
+
+	b.rootSpan.Finish()
+	b.tracerCloser.Close()
+}
+
+func (b *Binder) newPortalID() string {
+	b.nextPortalID++
+	return fmt.Sprintf("%v_%v", b.document.ID, b.nextPortalID)
+}
+
+func (b *Binder) historySince(version int) []OTransform {
+	filtered := make([]OTransform, 0, len(b.history))
+	for _, h := range b.history {
+		if h.Version > version {
+			filtered = append(filtered, h)
+		}
+	}
+	return filtered
+}
+
+func (b *Binder) flush() {
+	span := b.tracer.StartSpan("flush", opentracing.ChildOf(b.rootSpan.Context()))
+	defer span.Finish()
+	span.SetTag("document.id", b.document.ID)
+	span.SetTag("document.version", b.version)
+
+	b.document.Version = b.version
+	if err := b.store.Store(b.document); err != nil {
+		span.SetTag("error", true)
+		if b.errorChan != nil {
+			b.errorChan <- BinderError{DocumentID: b.document.ID, Err: err}
+		}
+	}
+}
+
+func (b *Binder) sampleWindow() time.Duration {
+	window := time.Duration(b.config.SampleWindow) * time.Millisecond
+	if window <= 0 {
+		window = 100 * time.Millisecond
+	}
+	return window
+}
+
+func (b *Binder) stallTimeout() time.Duration {
+	timeout := time.Duration(b.config.ClientStallTimeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	return timeout
+}
+
+// broadcast dispatches tform to every subscribed portal. A portal whose
+// channel still holds an undelivered batch, or which is over its
+// ClientReadLimit, has tform merged into its pending backlog rather than
+// losing it; an actively-draining client gets a Gosched-backed second
+// attempt at delivering that backlog in one batch (giving its goroutine a
+// real chance to be scheduled and take the previous batch first), and a
+// longer grace period (ClientStallTimeout) before broadcast gives up and
+// disconnects it. Either way a transform is never silently dropped on a
+// full buffer.
+func (b *Binder) broadcast(tform OTransform) {
+	for id, pi := range b.portals {
+		pi.pending = append(pi.pending, tform)
+
+		if b.tryFlushPending(pi) {
+			continue
+		}
+		runtime.Gosched()
+		if b.tryFlushPending(pi) {
+			continue
+		}
+
+		if pi.pendingSince.IsZero() {
+			pi.pendingSince = time.Now()
+			continue
+		}
+		if time.Since(pi.pendingSince) < b.stallTimeout() {
+			continue
+		}
+		pi.close()
+		delete(b.portals, id)
+	}
+}
+
+// tryFlushPending delivers pi's whole pending backlog as a single batch,
+// provided doing so fits within its ClientReadLimit, and reports whether it
+// did. The binder's loop is this channel's only sender, so an empty buffer
+// guarantees the send below won't block — checked first so the limiter is
+// only ever charged for bytes that are actually about to be delivered,
+// rather than being re-charged on every retry against a buffer that's
+// still full.
+func (b *Binder) tryFlushPending(pi *portalInternal) bool {
+	if len(pi.ch) != 0 {
+		return false
+	}
+
+	size := 0
+	for _, p := range pi.pending {
+		size += len(p.Insert) + p.Delete
+	}
+	if pi.readLimiter.Limit(size, 0) != nil {
+		return false
+	}
+
+	payload := make([]interface{}, len(pi.pending))
+	for i, p := range pi.pending {
+		payload[i] = p
+	}
+	pi.ch <- payload
+	pi.pending = nil
+	pi.pendingSince = time.Time{}
+	return true
+}
+
+func (b *Binder) transformParent(tform OTransform) opentracing.SpanContext {
+	if len(tform.SpanContext) > 0 {
+		if sc, err := b.tracer.Extract(opentracing.TextMap, opentracing.TextMapCarrier(tform.SpanContext)); err == nil {
+			return sc
+		}
+	}
+	return b.rootSpan.Context()
+}
+
+func (b *Binder) applyTransform(tform OTransform) (OTransform, error) {
+	span := b.tracer.StartSpan("apply_transform", opentracing.ChildOf(b.transformParent(tform)))
+	defer span.Finish()
+	span.SetTag("document.id", b.document.ID)
+	span.SetTag("transform.position", tform.Position)
+	span.SetTag("transform.insert_size", len(tform.Insert))
+	span.SetTag("transform.delete_size", tform.Delete)
+
+	content, ok := b.document.Content.(string)
+	if !ok {
+		span.SetTag("error", true)
+		return OTransform{}, ErrNonTextDocument
+	}
+
+	corrected := tform
+	if tform.Version <= b.version {
+		corrected = TransformAgainstHistory(tform, b.historySince(tform.Version-1))
+	}
+
+	b.document.Content = corrected.Apply(content)
+	b.version++
+	corrected.Version = b.version
+	b.history = append(b.history, corrected)
+
+	span.SetTag("document.version", corrected.Version)
+
+	return corrected, nil
+}
+
+func (b *Binder) loop() {
+	flushPeriod := time.Duration(b.config.FlushPeriod) * time.Millisecond
+	if flushPeriod <= 0 {
+		flushPeriod = time.Minute
+	}
+	ticker := time.NewTicker(flushPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case req := <-b.subscribeChan:
+			id := b.newPortalID()
+			pi := &portalInternal{
+				ch:           make(chan []interface{}, 1),
+				readLimiter:  newLimiter(b.config.ClientReadLimit, b.sampleWindow()),
+				writeLimiter: newLimiter(b.config.ClientWriteLimit, b.sampleWindow()),
+			}
+			b.portals[id] = pi
+
+			docCopy := *b.document
+			req.resultChan <- &BinderPortal{
+				ID:               id,
+				Version:          b.version,
+				Document:         &docCopy,
+				UserID:           req.userID,
+				perms:            req.perms,
+				TransformRcvChan: pi.ch,
+				writeLimiter:     pi.writeLimiter,
+				cancelChan:       make(chan struct{}),
+				binder:           b,
+			}
+		case subm := <-b.transformChan:
+			corrected, err := b.applyTransform(subm.transform)
+			if err != nil {
+				subm.errChan <- err
+				continue
+			}
+			b.broadcast(corrected)
+			subm.versionChan <- corrected.Version
+		case req := <-b.unsubscribeChan:
+			if pi, ok := b.portals[req.portalID]; ok {
+				// Drain any undelivered batch before closing. The loop is
+				// the channel's only sender, so this can't block.
+				select {
+				case <-pi.ch:
+				default:
+				}
+				pi.close()
+				delete(b.portals, req.portalID)
+			}
+		case <-ticker.C:
+			b.flush()
+		case <-b.closeChan:
+			for id, pi := range b.portals {
+				pi.close()
+				delete(b.portals, id)
+			}
+			b.flush()
+			close(b.closedChan)
+			return
+		}
+	}
+}
+
+// BinderPortal is the handle through which a single client interacts with a
+// Binder: submitting its own transforms and receiving the transforms
+// broadcast by everyone else.
+type BinderPortal struct {
+	ID       string
+	Version  int
+	Document *Document
+
+	// UserID is the id resolved by the binder's Authenticator when this
+	// portal was obtained via SubscribeAs, or empty for a portal obtained
+	// via Subscribe (or SubscribeAs with no Authenticator configured).
+	UserID string
+
+	TransformRcvChan chan []interface{}
+
+	perms        Permissions
+	writeLimiter *limiter
+	binder       *Binder
+
+	deadlineMutex sync.Mutex
+	deadlineTimer *time.Timer
+	cancelChan    chan struct{}
+}
+
+// WriteStatus returns the transfer rate at which this portal is submitting
+// transforms.
+func (p *BinderPortal) WriteStatus() MonitorStatus {
+	return p.writeLimiter.Status()
+}
+
+// Permissions returns the permissions this portal was granted on
+// subscription.
+func (p *BinderPortal) Permissions() Permissions {
+	return p.perms
+}
+
+// SetDeadline sets both the read and write deadlines, as with net.Conn. A
+// zero value for t clears any previously set deadline.
+func (p *BinderPortal) SetDeadline(t time.Time) error {
+	p.setDeadline(t)
+	return nil
+}
+
+// SetReadDeadline sets the deadline for RecvTransform. Read and write
+// deadlines share a single timer, so this also replaces any write deadline
+// and bounds SendTransform calls too.
+func (p *BinderPortal) SetReadDeadline(t time.Time) error {
+	p.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for SendTransform calls. Read and write
+// deadlines share a single timer, so this also replaces any read deadline
+// and bounds RecvTransform too.
+func (p *BinderPortal) SetWriteDeadline(t time.Time) error {
+	p.setDeadline(t)
+	return nil
+}
+
+// setDeadline stops any timer already pending, resetting the cancel channel
+// if that timer had already fired, and (for a non-zero deadline) starts an
+// AfterFunc that will close the current cancel channel once it elapses.
+func (p *BinderPortal) setDeadline(t time.Time) {
+	p.deadlineMutex.Lock()
+	defer p.deadlineMutex.Unlock()
+
+	if p.deadlineTimer != nil && !p.deadlineTimer.Stop() {
+		// The previous timer already fired (and closed cancelChan); start
+		// the next deadline against a fresh one.
+		p.cancelChan = make(chan struct{})
+	}
+	p.deadlineTimer = nil
+
+	if t.IsZero() {
+		return
+	}
+
+	cancelChan := p.cancelChan
+	p.deadlineTimer = time.AfterFunc(time.Until(t), func() {
+		close(cancelChan)
+	})
+}
+
+func (p *BinderPortal) currentCancelChan() chan struct{} {
+	p.deadlineMutex.Lock()
+	defer p.deadlineMutex.Unlock()
+	return p.cancelChan
+}
+
+// unsubscribe asks the binder to drop this portal immediately, closing its
+// TransformRcvChan without treating it as a stalled/bad client.
+func (p *BinderPortal) unsubscribe() {
+	select {
+	case p.binder.unsubscribeChan <- unsubscribeRequest{portalID: p.ID}:
+	case <-p.binder.closedChan:
+	}
+}
+
+// RecvTransform waits for the next batch of transforms to be dispatched to
+// this portal, honouring any deadline set via SetDeadline, SetReadDeadline
+// or SetWriteDeadline. It returns io.EOF once the portal has been closed
+// (e.g. by Binder.Close, a stall disconnect, or the context of a portal
+// obtained via SubscribeContext being done).
+func (p *BinderPortal) RecvTransform() ([]interface{}, error) {
+	select {
+	case tforms, open := <-p.TransformRcvChan:
+		if !open {
+			return nil, io.EOF
+		}
+		return tforms, nil
+	case <-p.currentCancelChan():
+		return nil, ErrDeadlineExceeded
+	}
+}
+
+// SendTransform submits a transform to the portal's binder, blocking until
+// it has either been applied or timeout elapses. On success it returns the
+// new document version. If the portal is submitting transforms faster than
+// its configured ClientWriteLimit allows, SendTransform blocks (up to
+// timeout) for budget to free up before returning ErrLimitExceeded. A
+// portal with PermReadOnly permissions (see SubscribeAs) always fails
+// immediately with ErrVerifyOnly.
+func (p *BinderPortal) SendTransform(tform OTransform, timeout time.Duration) (int, error) {
+	if p.perms != PermReadWrite {
+		return 0, ErrVerifyOnly
+	}
+
+	tracer := p.binder.tracer
+	span := tracer.StartSpan("send_transform", opentracing.ChildOf(p.binder.transformParent(tform)))
+	defer span.Finish()
+	span.SetTag("document.id", p.Document.ID)
+	span.SetTag("portal.id", p.ID)
+	span.SetTag("transform.position", tform.Position)
+	span.SetTag("transform.insert_size", len(tform.Insert))
+	span.SetTag("transform.delete_size", tform.Delete)
+
+	// Re-inject so the merge loop's span joins this one rather than
+	// whatever (or nothing) the client originally sent.
+	if tform.SpanContext == nil {
+		tform.SpanContext = map[string]string{}
+	}
+	tracer.Inject(span.Context(), opentracing.TextMap, opentracing.TextMapCarrier(tform.SpanContext))
+
+	if err := p.writeLimiter.Limit(len(tform.Insert)+tform.Delete, timeout); err != nil {
+		span.SetTag("error", true)
+		return 0, err
+	}
+
+	cancelChan := p.currentCancelChan()
+
+	subm := transformSubmission{
+		portalID:    p.ID,
+		transform:   tform,
+		versionChan: make(chan int, 1),
+		errChan:     make(chan error, 1),
+	}
+
+	select {
+	case p.binder.transformChan <- subm:
+	case <-time.After(timeout):
+		span.SetTag("error", true)
+		return 0, ErrTransformTimeout
+	case <-cancelChan:
+		span.SetTag("error", true)
+		return 0, ErrDeadlineExceeded
+	}
+
+	select {
+	case v := <-subm.versionChan:
+		span.SetTag("document.version", v)
+		return v, nil
+	case err := <-subm.errChan:
+		span.SetTag("error", true)
+		return 0, err
+	case <-time.After(timeout):
+		span.SetTag("error", true)
+		return 0, ErrTransformTimeout
+	case <-cancelChan:
+		span.SetTag("error", true)
+		return 0, ErrDeadlineExceeded
+	}
+}
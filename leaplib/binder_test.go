@@ -23,10 +23,12 @@ THE SOFTWARE.
 package leaplib
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -82,6 +84,66 @@ func TestNewBinder(t *testing.T) {
 	}
 }
 
+func TestBindNewResumesFromStore(t *testing.T) {
+	errChan := make(chan BinderError)
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	store := &MemoryStore{documents: map[string]*Document{}}
+
+	doc, err := CreateNewDocument("test", "test1", "text", "hello world")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	binder, err := BindNew(doc, store, DefaultBinderConfig(), errChan, logger)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	go func() {
+		for err := range errChan {
+			t.Errorf("From error channel: %v", err.Err)
+		}
+	}()
+
+	portal := binder.Subscribe()
+	if v, err := portal.SendTransform(
+		OTransform{Position: 6, Version: portal.Version + 1, Delete: 5, Insert: "universe"},
+		time.Second,
+	); v != 2 || err != nil {
+		t.Fatalf("Send Transform error, v: %v, err: %v", v, err)
+	}
+
+	binder.Close()
+
+	errChan2 := make(chan BinderError)
+	go func() {
+		for err := range errChan2 {
+			t.Errorf("From error channel: %v", err.Err)
+		}
+	}()
+
+	// A second Binder taking over the same store-backed document (as a
+	// server restart or another server taking over a crashed one would) is
+	// expected to resume from the last flushed content and version rather
+	// than resetting history back to version 1.
+	resumed, err := BindNew(doc, store, DefaultBinderConfig(), errChan2, logger)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	defer resumed.Close()
+
+	resumedPortal := resumed.Subscribe()
+	if exp, rec := "hello universe", resumedPortal.Document.Content.(string); exp != rec {
+		t.Errorf("Wrong content, expected %v, received %v", exp, rec)
+	}
+	if resumedPortal.Version != 2 {
+		t.Errorf("Expected resumed binder to carry over version 2, got %v", resumedPortal.Version)
+	}
+}
+
 func badClient(b *BinderPortal, t *testing.T, wg *sync.WaitGroup) {
 	// Do nothing, LOLOLOLOLOL AHAHAHAHAHAHAHAHAHA! TIME WASTTTTIIINNNGGGG!!!!
 	time.Sleep(100 * time.Millisecond)
@@ -99,7 +161,10 @@ func goodClient(b *BinderPortal, expecting int, t *testing.T, wg *sync.WaitGroup
 	changes := b.Version + 1
 	seen := 0
 	for change := range b.TransformRcvChan {
-		seen++
+		// broadcast may merge more than one transform into a single batch
+		// when this client is briefly behind, so count individual
+		// transforms rather than receives.
+		seen += len(change)
 		for _, tformWrap := range change {
 			tform, ok := tformWrap.(OTransform)
 			if !ok {
@@ -225,6 +290,318 @@ func goodStoryClient(b *BinderPortal, bstory *binderStory, wg *sync.WaitGroup, t
 	}()
 }
 
+func TestClientWriteLimit(t *testing.T) {
+	errChan := make(chan BinderError)
+	config := DefaultBinderConfig()
+	config.ClientWriteLimit = 10
+	config.SampleWindow = 10
+
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	doc, err := CreateNewDocument("test", "test1", "text", "hello world")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	binder, err := BindNew(doc, &MemoryStore{documents: map[string]*Document{}}, config, errChan, logger)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	defer binder.Close()
+
+	go func() {
+		for err := range errChan {
+			t.Errorf("From error channel: %v", err.Err)
+		}
+	}()
+
+	portal := binder.Subscribe()
+	go func() {
+		for range portal.TransformRcvChan {
+		}
+	}()
+
+	bigTform := OTransform{Position: 0, Version: portal.Version + 1, Delete: 0, Insert: "this insert is much bigger than the cap"}
+
+	if _, err := portal.SendTransform(bigTform, 0); err != ErrLimitExceeded {
+		t.Errorf("Expected ErrLimitExceeded for oversized write with no patience, got: %v", err)
+	}
+
+	smallTform := OTransform{Position: 0, Version: portal.Version + 1, Delete: 0, Insert: "ok"}
+	if _, err := portal.SendTransform(smallTform, time.Second); err != nil {
+		t.Errorf("Expected small write to succeed once earlier budget is unconsumed, got: %v", err)
+	}
+}
+
+func TestClientStallDisconnect(t *testing.T) {
+	errChan := make(chan BinderError)
+	config := DefaultBinderConfig()
+	config.ClientStallTimeout = 30
+	config.SampleWindow = 10
+
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	doc, err := CreateNewDocument("test", "test1", "text", "hello world")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	binder, err := BindNew(doc, &MemoryStore{documents: map[string]*Document{}}, config, errChan, logger)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	defer binder.Close()
+
+	go func() {
+		for err := range errChan {
+			t.Errorf("From error channel: %v", err.Err)
+		}
+	}()
+
+	writer := binder.Subscribe()
+	slow := binder.Subscribe()
+
+	stop := make(chan struct{})
+	go func() {
+		defer close(stop)
+		for i := 0; i < 40; i++ {
+			if _, err := writer.SendTransform(tformAt(writer.Version+i+1, 0), time.Second); err != nil {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	// The slow client's single buffered slot is filled by the very first
+	// broadcast; draining it once simulates a client that then stops
+	// reading entirely, rather than the good-client/bad-client distinction
+	// being made by whether the channel ever blocks at all.
+	select {
+	case _, open := <-slow.TransformRcvChan:
+		if !open {
+			t.Fatalf("slow client was disconnected before its first transform")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("slow client never received its first transform")
+	}
+
+	// From here the slow client is left completely undrained for well
+	// longer than ClientStallTimeout, so that every broadcast to it misses
+	// for the whole grace period rather than racing our own reads. By the
+	// time we look again it must already have been disconnected.
+	time.Sleep(time.Duration(config.ClientStallTimeout*3) * time.Millisecond)
+
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case _, open := <-slow.TransformRcvChan:
+			if !open {
+				<-stop
+				return
+			}
+		case <-deadline:
+			t.Fatalf("stalled client was never disconnected")
+		}
+	}
+}
+
+func TestClientReadLimit(t *testing.T) {
+	errChan := make(chan BinderError)
+	config := DefaultBinderConfig()
+	config.ClientReadLimit = 1
+	config.ClientStallTimeout = 30
+	config.SampleWindow = 10
+
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	doc, err := CreateNewDocument("test", "test1", "text", "hello world")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	binder, err := BindNew(doc, &MemoryStore{documents: map[string]*Document{}}, config, errChan, logger)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	defer binder.Close()
+
+	go func() {
+		for err := range errChan {
+			t.Errorf("From error channel: %v", err.Err)
+		}
+	}()
+
+	writer := binder.Subscribe()
+	reader := binder.Subscribe()
+
+	readerDone := make(chan struct{})
+	go func() {
+		for range reader.TransformRcvChan {
+		}
+		close(readerDone)
+	}()
+
+	// reader promptly drains every transform, so it can only be
+	// disconnected via the stall detection's ClientReadLimit accounting,
+	// not via a full buffered channel.
+	for i := 0; i < 40; i++ {
+		if _, err := writer.SendTransform(tformAt(writer.Version+i+1, 0), time.Second); err != nil {
+			t.Fatalf("send %v: %v", i, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	select {
+	case <-readerDone:
+	case <-time.After(time.Second):
+		t.Fatalf("reader exceeding ClientReadLimit was never disconnected")
+	}
+}
+
+// blockingStore wraps a MemoryStore but, once armed, blocks inside Store
+// until released. Used to occupy a binder's loop goroutine on its periodic
+// flush, so a test can prove a deadline fires while the loop is genuinely
+// busy rather than racing one that's sitting idle in its select.
+type blockingStore struct {
+	*MemoryStore
+	armed   int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingStore() *blockingStore {
+	return &blockingStore{
+		MemoryStore: &MemoryStore{documents: map[string]*Document{}},
+		started:     make(chan struct{}),
+		release:     make(chan struct{}),
+	}
+}
+
+func (s *blockingStore) Store(doc *Document) error {
+	if atomic.LoadInt32(&s.armed) == 1 {
+		close(s.started)
+		<-s.release
+	}
+	return s.MemoryStore.Store(doc)
+}
+
+func TestPortalDeadlineExpiry(t *testing.T) {
+	errChan := make(chan BinderError)
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	doc, err := CreateNewDocument("test", "test1", "text", "hello world")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	store := newBlockingStore()
+	config := DefaultBinderConfig()
+	config.FlushPeriod = 10
+
+	binder, err := BindNew(doc, store, config, errChan, logger)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	defer binder.Close()
+
+	go func() {
+		for err := range errChan {
+			t.Errorf("From error channel: %v", err.Err)
+		}
+	}()
+
+	portal := binder.Subscribe()
+
+	// Arm the store and wait for the next periodic flush to enter it and
+	// block, so the loop genuinely can't service SendTransform's submission
+	// until released: the deadline below is then guaranteed to win the
+	// race rather than just being likely to.
+	atomic.StoreInt32(&store.armed, 1)
+	<-store.started
+
+	portal.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+
+	// SendTransform's own timeout (1s) is far longer than the write
+	// deadline, so it should still be cut short by the deadline.
+	if _, err := portal.SendTransform(tformAt(portal.Version+1, 0), time.Second); err != ErrDeadlineExceeded {
+		t.Errorf("Expected ErrDeadlineExceeded, got: %v", err)
+	}
+
+	// Disarm and release the blocked flush so the binder's loop is
+	// serviceable again for the rest of the test.
+	atomic.StoreInt32(&store.armed, 0)
+	close(store.release)
+
+	// Clearing the deadline (zero value) should let sends succeed again.
+	portal.SetWriteDeadline(time.Time{})
+	if _, err := portal.SendTransform(tformAt(portal.Version+1, 0), time.Second); err != nil {
+		t.Errorf("Expected send to succeed once deadline cleared, got: %v", err)
+	}
+
+	// The send above broadcasts back to this same portal; drain it before
+	// exercising the read deadline so RecvTransform actually has to wait.
+	<-portal.TransformRcvChan
+
+	portal.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := portal.RecvTransform(); err != ErrDeadlineExceeded {
+		t.Errorf("Expected ErrDeadlineExceeded from RecvTransform, got: %v", err)
+	}
+}
+
+func tformAt(version, pos int) OTransform {
+	return OTransform{Position: pos, Version: version, Delete: 0, Insert: "x"}
+}
+
+func TestPortalContextCancellation(t *testing.T) {
+	errChan := make(chan BinderError)
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	doc, err := CreateNewDocument("test", "test1", "text", "hello world")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	binder, err := BindNew(doc, &MemoryStore{documents: map[string]*Document{}}, DefaultBinderConfig(), errChan, logger)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	defer binder.Close()
+
+	go func() {
+		for err := range errChan {
+			t.Errorf("From error channel: %v", err.Err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	portal := binder.SubscribeContext(ctx)
+
+	cancel()
+
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case _, open := <-portal.TransformRcvChan:
+			if !open {
+				return
+			}
+		case <-deadline:
+			t.Errorf("TransformRcvChan was not closed after context cancellation")
+			return
+		}
+	}
+}
+
 func TestBinderStories(t *testing.T) {
 	nClients := 10
 
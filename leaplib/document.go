@@ -0,0 +1,60 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import "errors"
+
+// ErrEmptyDocumentID is returned when a document is created without an id.
+var ErrEmptyDocumentID = errors.New("document id must not be empty")
+
+// Document is the container of content that a Binder manages and distributes
+// transforms against. Content is left as an interface{} so that leaps can
+// manage documents of varying types (plain text, rich structured data, etc).
+type Document struct {
+	ID          string      `json:"id"`
+	Type        string      `json:"type"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Content     interface{} `json:"content"`
+
+	// Version is the last document version this content reflects. It is
+	// persisted alongside Content so that a Binder taking over a document
+	// from its DocumentStore (e.g. after a crash, via EtcdStore) can resume
+	// numbering transforms from where the previous holder left off instead
+	// of restarting history from version 1.
+	Version int `json:"version"`
+}
+
+// CreateNewDocument creates a fresh Document with the given id, title,
+// content type and initial content.
+func CreateNewDocument(id, title, docType string, content interface{}) (*Document, error) {
+	if len(id) == 0 {
+		return nil, ErrEmptyDocumentID
+	}
+	return &Document{
+		ID:      id,
+		Type:    docType,
+		Title:   title,
+		Content: content,
+	}, nil
+}
@@ -0,0 +1,317 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/concurrency"
+)
+
+// EtcdStoreConfig holds configuration options for an EtcdStore.
+type EtcdStoreConfig struct {
+	// Endpoints is the list of etcd cluster members to dial.
+	Endpoints []string `json:"endpoints"`
+
+	// KeyPrefix is prepended to every document id to form its etcd key,
+	// e.g. a prefix of "/leaps/documents/" and a document id of "foo"
+	// store the document under "/leaps/documents/foo". It is also the base
+	// under which per-document lock keys are held (see acquireLock).
+	KeyPrefix string `json:"key_prefix"`
+
+	// LeaseTTL is the lifetime, in seconds, of the lease a binder holds
+	// while it is the active host of a document. The lease is kept alive
+	// for as long as the local binder is running; if this server dies
+	// without a clean shutdown the lease (and with it the lock) expires
+	// after this many seconds, allowing another server to take over.
+	LeaseTTL int64 `json:"lease_ttl_s"`
+
+	// DialTimeout bounds how long to wait when first connecting to the
+	// cluster, in seconds.
+	DialTimeout int64 `json:"dial_timeout_s"`
+
+	// TLS configuration, all optional. When CertFile and KeyFile are both
+	// set client certificate authentication is used.
+	CertFile   string `json:"cert_file"`
+	KeyFile    string `json:"key_file"`
+	CAFile     string `json:"ca_file"`
+	ServerName string `json:"server_name"`
+}
+
+// DefaultEtcdStoreConfig returns an EtcdStoreConfig populated with sane
+// defaults.
+func DefaultEtcdStoreConfig() EtcdStoreConfig {
+	return EtcdStoreConfig{
+		Endpoints:   []string{"localhost:2379"},
+		KeyPrefix:   "/leaps/documents/",
+		LeaseTTL:    10,
+		DialTimeout: 5,
+	}
+}
+
+func (e EtcdStoreConfig) tlsConfig() (*tls.Config, error) {
+	if len(e.CertFile) == 0 && len(e.KeyFile) == 0 && len(e.CAFile) == 0 {
+		return nil, nil
+	}
+
+	conf := &tls.Config{ServerName: e.ServerName}
+
+	if len(e.CertFile) > 0 && len(e.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(e.CertFile, e.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client keypair: %v", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(e.CAFile) > 0 {
+		caBytes, err := ioutil.ReadFile(e.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("failed to parse ca file: %v", e.CAFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	return conf, nil
+}
+
+// EtcdStore is a DocumentStore implementation backed by etcd, allowing a
+// cluster of leaps servers to share document state and hand a document off
+// between servers as they come and go. Each document is JSON-encoded under
+// its own key, which is not tied to any lease; the holding server's lock is
+// held on a lease that it keeps alive, and losing that lease (a crash, a
+// network partition) allows another server to pick the document back up
+// from the last value written.
+//
+// Exclusive hosting of a document is enforced with a real etcd mutex (see
+// acquireLock), not just a locally-held lease: acquireLock blocks until it
+// wins that mutex, so two servers can never both believe they're the active
+// host of the same document at once.
+type EtcdStore struct {
+	config EtcdStoreConfig
+	client *etcd.Client
+
+	mutex     sync.Mutex
+	leases    map[string]etcd.LeaseID
+	sessions  map[string]*concurrency.Session
+	locks     map[string]*concurrency.Mutex
+	acquiring map[string]*sync.Mutex
+}
+
+// NewEtcdStore connects to an etcd cluster and returns an EtcdStore ready to
+// back one or more Binders.
+func NewEtcdStore(config EtcdStoreConfig) (*EtcdStore, error) {
+	tlsConf, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := etcd.New(etcd.Config{
+		Endpoints:   config.Endpoints,
+		DialTimeout: time.Duration(config.DialTimeout) * time.Second,
+		TLS:         tlsConf,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to etcd: %v", err)
+	}
+
+	return &EtcdStore{
+		config:    config,
+		client:    client,
+		leases:    map[string]etcd.LeaseID{},
+		sessions:  map[string]*concurrency.Session{},
+		locks:     map[string]*concurrency.Mutex{},
+		acquiring: map[string]*sync.Mutex{},
+	}, nil
+}
+
+func (e *EtcdStore) keyFor(id string) string {
+	return e.config.KeyPrefix + id
+}
+
+// acquiringMutex returns the per-document-id mutex that serializes
+// acquireLock calls for id, creating it on first use. acquireLock itself
+// can block on etcd for as long as LeaseTTL, so this is scoped per id
+// rather than using e.mutex directly, which would otherwise serialize
+// acquisition of every other, unrelated document behind that wait too.
+func (e *EtcdStore) acquiringMutex(id string) *sync.Mutex {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	m, exists := e.acquiring[id]
+	if !exists {
+		m = &sync.Mutex{}
+		e.acquiring[id] = m
+	}
+	return m
+}
+
+// lockPrefixFor returns the etcd key prefix the distributed mutex for
+// document id is held under, kept separate from the document's own key so
+// locking never contends with Get/Put traffic against the document itself.
+func (e *EtcdStore) lockPrefixFor(id string) string {
+	return e.config.KeyPrefix + "locks/" + id
+}
+
+// Fetch retrieves a document by id, returning ErrDocumentNotExist if it has
+// never been stored.
+func (e *EtcdStore) Fetch(id string) (*Document, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.config.DialTimeout)*time.Second)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, e.keyFor(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch document from etcd: %v", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrDocumentNotExist
+	}
+
+	doc := &Document{}
+	if err := json.Unmarshal(resp.Kvs[0].Value, doc); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %v", err)
+	}
+
+	// This is a plain point-in-time Get of the key, not a Watch: it reads
+	// whatever the last holder most recently Stored (including its
+	// Document.Version, which BindNew uses to resume history from the
+	// correct point) rather than subscribing to further changes. A taking-
+	// over server still has to wait out the previous holder's lease TTL
+	// (see acquireLock) before it can grab the lease itself.
+	if err := e.acquireLock(id); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// acquireLock grants a lease for the document id and blocks until it wins
+// the corresponding etcd mutex, so that at most one server in the cluster
+// ever believes it's the active host of a given document at once. If
+// another server is already holding the lock, this blocks until that
+// server's lease expires (it crashed or lost its connection) or it calls
+// Release, up to the document's LeaseTTL.
+func (e *EtcdStore) acquireLock(id string) error {
+	idMutex := e.acquiringMutex(id)
+	idMutex.Lock()
+	defer idMutex.Unlock()
+
+	e.mutex.Lock()
+	if _, exists := e.leases[id]; exists {
+		e.mutex.Unlock()
+		return nil
+	}
+	e.mutex.Unlock()
+
+	session, err := concurrency.NewSession(e.client, concurrency.WithTTL(int(e.config.LeaseTTL)))
+	if err != nil {
+		return fmt.Errorf("failed to create lock session: %v", err)
+	}
+
+	lock := concurrency.NewMutex(session, e.lockPrefixFor(id))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.config.LeaseTTL)*time.Second)
+	defer cancel()
+	if err := lock.Lock(ctx); err != nil {
+		session.Close()
+		return fmt.Errorf("failed to acquire document lock: %v", err)
+	}
+
+	e.mutex.Lock()
+	e.leases[id] = session.Lease()
+	e.sessions[id] = session
+	e.locks[id] = lock
+	e.mutex.Unlock()
+
+	return nil
+}
+
+// Store persists a document, first acquiring this store's lock on it if not
+// already held. The document's key is written without a lease, so it
+// outlives the lock's lease expiring or being released.
+func (e *EtcdStore) Store(doc *Document) error {
+	bytes, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode document: %v", err)
+	}
+
+	if err := e.acquireLock(doc.ID); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.config.DialTimeout)*time.Second)
+	defer cancel()
+
+	if _, err := e.client.Put(ctx, e.keyFor(doc.ID), string(bytes)); err != nil {
+		return fmt.Errorf("failed to store document in etcd: %v", err)
+	}
+
+	return nil
+}
+
+// Release unlocks and gives up this store's lease on a document, allowing
+// another server to take over hosting it immediately rather than waiting
+// for the lease TTL to expire.
+func (e *EtcdStore) Release(id string) {
+	e.mutex.Lock()
+	lock, session := e.locks[id], e.sessions[id]
+	delete(e.locks, id)
+	delete(e.sessions, id)
+	delete(e.leases, id)
+	e.mutex.Unlock()
+
+	if lock != nil {
+		lock.Unlock(context.Background())
+	}
+	if session != nil {
+		session.Close()
+	}
+}
+
+// Close releases every lock held by this store and closes its etcd client.
+func (e *EtcdStore) Close() error {
+	e.mutex.Lock()
+	ids := make([]string, 0, len(e.leases))
+	for id := range e.leases {
+		ids = append(ids, id)
+	}
+	e.mutex.Unlock()
+
+	for _, id := range ids {
+		e.Release(id)
+	}
+
+	return e.client.Close()
+}
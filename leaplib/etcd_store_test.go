@@ -0,0 +1,159 @@
+//go:build etcd
+// +build etcd
+
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+// These tests drive the same scenarios as TestBinderStories, but through a
+// Binder backed by an EtcdStore talking to an embedded etcd server rather
+// than a MemoryStore. They're gated behind the "etcd" build tag since they
+// spin up a real (if embedded) etcd instance and are too heavy to run as
+// part of the default unit test suite.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+)
+
+func startEmbeddedEtcd(t *testing.T) (*embed.Etcd, string) {
+	dir, err := ioutil.TempDir("", "leaps-etcd-test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("failed to start embedded etcd: %v", err)
+	}
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Server.Stop()
+		t.Fatalf("embedded etcd took too long to start")
+	}
+
+	return e, dir
+}
+
+func TestBinderStoriesWithEtcdStore(t *testing.T) {
+	etcdServer, dir := startEmbeddedEtcd(t)
+	defer func() {
+		etcdServer.Close()
+		os.RemoveAll(dir)
+	}()
+
+	endpoints := make([]string, 0, len(etcdServer.Clients))
+	for _, l := range etcdServer.Clients {
+		endpoints = append(endpoints, l.Addr().String())
+	}
+
+	nClients := 10
+
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	bytes, err := ioutil.ReadFile("../data/binder_stories.js")
+	if err != nil {
+		t.Fatalf("Read file error: %v", err)
+	}
+
+	var scont binderStoriesContainer
+	if err := json.Unmarshal(bytes, &scont); err != nil {
+		t.Fatalf("Story parse error: %v", err)
+	}
+
+	for i, story := range scont.Stories {
+		storeConf := DefaultEtcdStoreConfig()
+		storeConf.Endpoints = endpoints
+		storeConf.KeyPrefix = fmt.Sprintf("/leaps/test/%v/", i)
+
+		store, err := NewEtcdStore(storeConf)
+		if err != nil {
+			t.Fatalf("failed to create etcd store: %v", err)
+		}
+
+		doc, err := CreateNewDocument(fmt.Sprintf("story%v", i), "testing", "text", story.Content)
+		if err != nil {
+			t.Errorf("error: %v", err)
+			continue
+		}
+
+		config := DefaultBinderConfig()
+		errChan := make(chan BinderError)
+		go func() {
+			for err := range errChan {
+				t.Errorf("From error channel: %v", err.Err)
+			}
+		}()
+
+		binder, err := BindNew(doc, store, config, errChan, logger)
+		if err != nil {
+			t.Errorf("error: %v", err)
+			continue
+		}
+
+		wg := sync.WaitGroup{}
+		wg.Add(nClients)
+
+		for j := 0; j < nClients; j++ {
+			goodStoryClient(binder.Subscribe(), &story, &wg, t)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		bp := binder.Subscribe()
+		go func() {
+			for range bp.TransformRcvChan {
+			}
+		}()
+
+		for j := 0; j < len(story.Transforms); j++ {
+			if _, err = bp.SendTransform(story.Transforms[j], time.Second); err != nil {
+				t.Errorf("Send issue %v", err)
+			}
+		}
+
+		wg.Wait()
+
+		newClient := binder.Subscribe()
+		if got, exp := newClient.Document.Content.(string), story.Result; got != exp {
+			t.Errorf("Wrong result, expected: %v, received: %v", exp, got)
+		}
+
+		binder.Close()
+		store.Close()
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sync"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// Errors returned by JWTAuthenticator.Verify.
+var (
+	ErrTokenInvalid = errors.New("token is malformed or has an invalid signature")
+	ErrTokenExpired = errors.New("token has expired")
+	ErrUserRevoked  = errors.New("user has been revoked")
+)
+
+// leapsClaims is the JWT claim set a JWTAuthenticator expects. Perms is
+// "rw" for read-write access and anything else (including absent) for
+// read-only access.
+type leapsClaims struct {
+	jwt.StandardClaims
+	Perms string `json:"perms"`
+	Doc   string `json:"doc,omitempty"`
+}
+
+// JWTAuthenticatorConfig holds configuration options for a JWTAuthenticator.
+type JWTAuthenticatorConfig struct {
+	// Algorithm is either "HS256" (HMACSecret is used) or "RS256"
+	// (RSAPublicKey is used). Tokens signed with any other algorithm are
+	// rejected.
+	Algorithm string `json:"algorithm"`
+
+	// HMACSecret is the shared secret used to verify HS256 tokens.
+	HMACSecret []byte `json:"-"`
+
+	// RSAPublicKey is used to verify RS256 tokens.
+	RSAPublicKey *rsa.PublicKey `json:"-"`
+
+	// Issuer, when non-empty, must match the token's iss claim.
+	Issuer string `json:"issuer"`
+
+	// Audience, when non-empty, must match the token's aud claim.
+	Audience string `json:"audience"`
+}
+
+// DefaultJWTAuthenticatorConfig returns a JWTAuthenticatorConfig defaulted
+// to HS256. HMACSecret (or RSAPublicKey, with Algorithm set to "RS256")
+// still needs to be set before use.
+func DefaultJWTAuthenticatorConfig() JWTAuthenticatorConfig {
+	return JWTAuthenticatorConfig{
+		Algorithm: "HS256",
+	}
+}
+
+// JWTAuthenticator is an Authenticator that verifies JWTs, supporting either
+// HS256 or RS256 signatures, expiry, issuer/audience checks, and revocation
+// of individual users after the fact.
+type JWTAuthenticator struct {
+	config JWTAuthenticatorConfig
+
+	mutex   sync.RWMutex
+	revoked map[string]struct{}
+}
+
+// NewJWTAuthenticator creates a JWTAuthenticator from a JWTAuthenticatorConfig.
+func NewJWTAuthenticator(config JWTAuthenticatorConfig) *JWTAuthenticator {
+	return &JWTAuthenticator{
+		config:  config,
+		revoked: map[string]struct{}{},
+	}
+}
+
+// Revoke blocks any future Verify call for userID from succeeding, without
+// affecting portals it has already subscribed through.
+func (a *JWTAuthenticator) Revoke(userID string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.revoked[userID] = struct{}{}
+}
+
+// Unrevoke reverses a prior call to Revoke.
+func (a *JWTAuthenticator) Unrevoke(userID string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.revoked, userID)
+}
+
+func (a *JWTAuthenticator) isRevoked(userID string) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	_, revoked := a.revoked[userID]
+	return revoked
+}
+
+// Verify implements Authenticator.
+func (a *JWTAuthenticator) Verify(token string, docID string) (string, Permissions, error) {
+	claims := &leapsClaims{}
+
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != a.config.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+		}
+		switch a.config.Algorithm {
+		case "RS256":
+			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			}
+			return a.config.RSAPublicKey, nil
+		default:
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+			}
+			return a.config.HMACSecret, nil
+		}
+	})
+
+	if err != nil {
+		if verr, ok := err.(*jwt.ValidationError); ok && verr.Errors&jwt.ValidationErrorExpired != 0 {
+			return "", PermReadOnly, ErrTokenExpired
+		}
+		return "", PermReadOnly, ErrTokenInvalid
+	}
+
+	if len(a.config.Issuer) > 0 && claims.Issuer != a.config.Issuer {
+		return "", PermReadOnly, ErrTokenInvalid
+	}
+	if len(a.config.Audience) > 0 && !claims.VerifyAudience(a.config.Audience, true) {
+		return "", PermReadOnly, ErrTokenInvalid
+	}
+	if len(claims.Doc) > 0 && claims.Doc != docID {
+		return "", PermReadOnly, ErrTokenInvalid
+	}
+
+	if a.isRevoked(claims.Subject) {
+		return "", PermReadOnly, ErrUserRevoked
+	}
+
+	perms := PermReadOnly
+	if claims.Perms == "rw" {
+		perms = PermReadWrite
+	}
+
+	return claims.Subject, perms, nil
+}
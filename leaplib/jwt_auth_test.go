@@ -0,0 +1,258 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func signToken(t *testing.T, secret []byte, claims leapsClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		t.Fatalf("failed to sign test token: %v", err)
+	}
+	return signed
+}
+
+func TestJWTAuthenticatorAcceptsReadWrite(t *testing.T) {
+	secret := []byte("test-secret")
+	auth := NewJWTAuthenticator(JWTAuthenticatorConfig{
+		Algorithm:  "HS256",
+		HMACSecret: secret,
+	})
+
+	token := signToken(t, secret, leapsClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "alice",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Perms: "rw",
+	})
+
+	userID, perms, err := auth.Verify(token, "doc1")
+	if err != nil {
+		t.Fatalf("expected token to verify, got: %v", err)
+	}
+	if userID != "alice" {
+		t.Errorf("expected userID 'alice', got '%v'", userID)
+	}
+	if perms != PermReadWrite {
+		t.Errorf("expected PermReadWrite, got %v", perms)
+	}
+}
+
+func TestJWTAuthenticatorDefaultsToReadOnly(t *testing.T) {
+	secret := []byte("test-secret")
+	auth := NewJWTAuthenticator(JWTAuthenticatorConfig{
+		Algorithm:  "HS256",
+		HMACSecret: secret,
+	})
+
+	token := signToken(t, secret, leapsClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "bob",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	})
+
+	_, perms, err := auth.Verify(token, "doc1")
+	if err != nil {
+		t.Fatalf("expected token to verify, got: %v", err)
+	}
+	if perms != PermReadOnly {
+		t.Errorf("expected PermReadOnly for a token with no perms claim, got %v", perms)
+	}
+}
+
+func TestJWTAuthenticatorRejectsExpired(t *testing.T) {
+	secret := []byte("test-secret")
+	auth := NewJWTAuthenticator(JWTAuthenticatorConfig{
+		Algorithm:  "HS256",
+		HMACSecret: secret,
+	})
+
+	token := signToken(t, secret, leapsClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "alice",
+			ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+		},
+		Perms: "rw",
+	})
+
+	if _, _, err := auth.Verify(token, "doc1"); err != ErrTokenExpired {
+		t.Errorf("expected ErrTokenExpired, got: %v", err)
+	}
+}
+
+func TestJWTAuthenticatorRejectsBadSignature(t *testing.T) {
+	auth := NewJWTAuthenticator(JWTAuthenticatorConfig{
+		Algorithm:  "HS256",
+		HMACSecret: []byte("test-secret"),
+	})
+
+	token := signToken(t, []byte("wrong-secret"), leapsClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "alice",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Perms: "rw",
+	})
+
+	if _, _, err := auth.Verify(token, "doc1"); err != ErrTokenInvalid {
+		t.Errorf("expected ErrTokenInvalid, got: %v", err)
+	}
+}
+
+func TestJWTAuthenticatorRejectsRevokedUsers(t *testing.T) {
+	secret := []byte("test-secret")
+	auth := NewJWTAuthenticator(JWTAuthenticatorConfig{
+		Algorithm:  "HS256",
+		HMACSecret: secret,
+	})
+
+	token := signToken(t, secret, leapsClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   "alice",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Perms: "rw",
+	})
+
+	auth.Revoke("alice")
+	if _, _, err := auth.Verify(token, "doc1"); err != ErrUserRevoked {
+		t.Errorf("expected ErrUserRevoked, got: %v", err)
+	}
+
+	auth.Unrevoke("alice")
+	if _, _, err := auth.Verify(token, "doc1"); err != nil {
+		t.Errorf("expected token to verify after unrevoke, got: %v", err)
+	}
+}
+
+func TestSubscribeAsReadOnlyCannotMutate(t *testing.T) {
+	secret := []byte("test-secret")
+	auth := NewJWTAuthenticator(JWTAuthenticatorConfig{
+		Algorithm:  "HS256",
+		HMACSecret: secret,
+	})
+
+	errChan := make(chan BinderError)
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	doc, err := CreateNewDocument("test", "test1", "text", "hello world")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	config := DefaultBinderConfig()
+	config.Authenticator = auth
+
+	binder, err := BindNew(doc, &MemoryStore{documents: map[string]*Document{}}, config, errChan, logger)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	defer binder.Close()
+
+	go func() {
+		for err := range errChan {
+			t.Errorf("From error channel: %v", err.Err)
+		}
+	}()
+
+	writer, err := binder.SubscribeAs(signToken(t, secret, leapsClaims{
+		StandardClaims: jwt.StandardClaims{Subject: "writer", ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		Perms:          "rw",
+	}))
+	if err != nil {
+		t.Fatalf("error subscribing writer: %v", err)
+	}
+
+	reader, err := binder.SubscribeAs(signToken(t, secret, leapsClaims{
+		StandardClaims: jwt.StandardClaims{Subject: "reader", ExpiresAt: time.Now().Add(time.Hour).Unix()},
+		Perms:          "r",
+	}))
+	if err != nil {
+		t.Fatalf("error subscribing reader: %v", err)
+	}
+	if reader.Permissions() != PermReadOnly {
+		t.Fatalf("expected reader to have PermReadOnly")
+	}
+
+	if _, err := reader.SendTransform(tformAt(reader.Version+1, 0), time.Second); err != ErrVerifyOnly {
+		t.Errorf("expected ErrVerifyOnly from read-only portal, got: %v", err)
+	}
+
+	if _, err := writer.SendTransform(tformAt(writer.Version+1, 0), time.Second); err != nil {
+		t.Fatalf("expected writer send to succeed, got: %v", err)
+	}
+
+	select {
+	case tforms, open := <-reader.TransformRcvChan:
+		if !open {
+			t.Fatalf("reader's TransformRcvChan was closed unexpectedly")
+		}
+		if len(tforms) == 0 {
+			t.Fatalf("expected reader to observe the writer's transform")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("reader did not observe the writer's transform in time")
+	}
+}
+
+func TestSubscribeAsWithNoAuthenticatorGrantsReadWrite(t *testing.T) {
+	errChan := make(chan BinderError)
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	doc, err := CreateNewDocument("test", "test1", "text", "hello world")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+
+	binder, err := BindNew(doc, &MemoryStore{documents: map[string]*Document{}}, DefaultBinderConfig(), errChan, logger)
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	defer binder.Close()
+
+	go func() {
+		for err := range errChan {
+			t.Errorf("From error channel: %v", err.Err)
+		}
+	}()
+
+	portal, err := binder.SubscribeAs("anything")
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if portal.Permissions() != PermReadWrite {
+		t.Errorf("expected PermReadWrite when no Authenticator is configured")
+	}
+}
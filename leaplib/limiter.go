@@ -0,0 +1,125 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLimitExceeded is returned by limiter.Limit when the caller is sending
+// faster than its configured cap allows and no budget frees up within the
+// call's patience.
+var ErrLimitExceeded = errors.New("transfer rate limit exceeded")
+
+// limiter is a token-bucket rate limiter backed by a Monitor, used to cap
+// how many bytes per second a single client may push into a binder, or have
+// dispatched to it. A limiter with bytesPerSec <= 0 is unlimited; it still
+// feeds its Monitor so Status() reporting keeps working.
+type limiter struct {
+	bytesPerSec int64
+	monitor     *Monitor
+
+	mutex      sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+}
+
+// newLimiter creates a limiter capped at bytesPerSec, sampling its rate on
+// the given window.
+func newLimiter(bytesPerSec int64, sampleWindow time.Duration) *limiter {
+	return &limiter{
+		bytesPerSec: bytesPerSec,
+		monitor:     NewMonitor(sampleWindow, 0.5),
+		tokens:      float64(bytesPerSec),
+		lastRefill:  time.Now(),
+	}
+}
+
+// Limit accounts for n units against the limiter's cap, blocking for up to
+// patience for enough budget to free up before giving up with
+// ErrLimitExceeded.
+func (l *limiter) Limit(n int, patience time.Duration) error {
+	if l.bytesPerSec <= 0 {
+		l.monitor.Add(n)
+		return nil
+	}
+
+	if l.take(n) {
+		l.monitor.Add(n)
+		return nil
+	}
+	if patience <= 0 {
+		return ErrLimitExceeded
+	}
+
+	deadline := time.Now().Add(patience)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		if l.take(n) {
+			l.monitor.Add(n)
+			return nil
+		}
+	}
+	return ErrLimitExceeded
+}
+
+func (l *limiter) take(n int) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.lastRefill).Seconds() * float64(l.bytesPerSec)
+
+	// Capacity is normally one second's worth of budget, but a single
+	// request bigger than that must still be able to accumulate enough
+	// tokens given enough patience, rather than being permanently and
+	// silently blocked regardless of how long the caller is willing to
+	// wait. So the cap grows to admit it, without raising the steady-state
+	// refill rate.
+	cap := float64(l.bytesPerSec)
+	if reqSize := float64(n); reqSize > cap {
+		cap = reqSize
+	}
+	if l.tokens > cap {
+		l.tokens = cap
+	}
+	l.lastRefill = now
+
+	if l.tokens < float64(n) {
+		return false
+	}
+	l.tokens -= float64(n)
+	return true
+}
+
+// Status returns the limiter's underlying transfer rate measurements.
+func (l *limiter) Status() MonitorStatus {
+	return l.monitor.Status()
+}
+
+// Close stops the limiter's internal monitor.
+func (l *limiter) Close() {
+	l.monitor.Close()
+}
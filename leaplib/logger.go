@@ -0,0 +1,95 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// LogLevel is the minimum severity of message that a Logger will print.
+type LogLevel int
+
+// Log levels, in ascending order of verbosity.
+const (
+	LeapError LogLevel = iota
+	LeapWarn
+	LeapInfo
+	LeapDebug
+)
+
+// LoggerConfig holds configuration options for a Logger.
+type LoggerConfig struct {
+	LogLevel LogLevel `json:"log_level"`
+	Prefix   string   `json:"prefix"`
+}
+
+// DefaultLoggerConfig returns a LoggerConfig populated with sane defaults.
+func DefaultLoggerConfig() LoggerConfig {
+	return LoggerConfig{
+		LogLevel: LeapInfo,
+		Prefix:   "leaps",
+	}
+}
+
+// Logger is a simple level-filtered wrapper around the standard log package.
+type Logger struct {
+	config LoggerConfig
+	logger *log.Logger
+}
+
+// CreateLogger creates a Logger from a LoggerConfig, printing to stdout.
+func CreateLogger(config LoggerConfig) *Logger {
+	return &Logger{
+		config: config,
+		logger: log.New(os.Stdout, fmt.Sprintf("[%v] ", config.Prefix), log.LstdFlags),
+	}
+}
+
+func (l *Logger) print(level LogLevel, tag, message string, args ...interface{}) {
+	if level > l.config.LogLevel {
+		return
+	}
+	l.logger.Printf("%v | "+message, append([]interface{}{tag}, args...)...)
+}
+
+// Errorf prints an error level message.
+func (l *Logger) Errorf(message string, args ...interface{}) {
+	l.print(LeapError, "ERROR", message, args...)
+}
+
+// Warnf prints a warn level message.
+func (l *Logger) Warnf(message string, args ...interface{}) {
+	l.print(LeapWarn, "WARN", message, args...)
+}
+
+// Infof prints an info level message.
+func (l *Logger) Infof(message string, args ...interface{}) {
+	l.print(LeapInfo, "INFO", message, args...)
+}
+
+// Debugf prints a debug level message.
+func (l *Logger) Debugf(message string, args ...interface{}) {
+	l.print(LeapDebug, "DEBUG", message, args...)
+}
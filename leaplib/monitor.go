@@ -0,0 +1,128 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MonitorStatus is a snapshot of a Monitor's observed transfer rate.
+type MonitorStatus struct {
+	InstRate   float64
+	AvgRate    float64
+	PeakRate   float64
+	BytesTotal int64
+}
+
+// Monitor tracks how many bytes (or transforms) are being pushed through it
+// per second. Samples are refreshed on a fixed tick rather than on every
+// Add call, and smoothed with an exponential moving average, so a single
+// large burst doesn't read the same as a sustained flood.
+type Monitor struct {
+	alpha      float64
+	tickPeriod time.Duration
+
+	bytesThisTick int64
+	bytesTotal    int64
+
+	mutex    sync.Mutex
+	instRate float64
+	avgRate  float64
+	peakRate float64
+
+	closeChan chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMonitor creates a Monitor that refreshes its rate sample every
+// tickPeriod, smoothing with exponential factor alpha (sample =
+// alpha*current + (1-alpha)*previous).
+func NewMonitor(tickPeriod time.Duration, alpha float64) *Monitor {
+	if tickPeriod <= 0 {
+		tickPeriod = 100 * time.Millisecond
+	}
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.5
+	}
+
+	m := &Monitor{
+		alpha:      alpha,
+		tickPeriod: tickPeriod,
+		closeChan:  make(chan struct{}),
+	}
+	go m.loop()
+
+	return m
+}
+
+// Add registers n bytes (or transforms, or whatever unit the caller is
+// measuring) as having just been observed.
+func (m *Monitor) Add(n int) {
+	atomic.AddInt64(&m.bytesThisTick, int64(n))
+	atomic.AddInt64(&m.bytesTotal, int64(n))
+}
+
+// Status returns a snapshot of the monitor's current rate measurements.
+func (m *Monitor) Status() MonitorStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return MonitorStatus{
+		InstRate:   m.instRate,
+		AvgRate:    m.avgRate,
+		PeakRate:   m.peakRate,
+		BytesTotal: atomic.LoadInt64(&m.bytesTotal),
+	}
+}
+
+// Close stops the monitor's sampling loop. Safe to call more than once.
+func (m *Monitor) Close() {
+	m.closeOnce.Do(func() {
+		close(m.closeChan)
+	})
+}
+
+func (m *Monitor) loop() {
+	ticker := time.NewTicker(m.tickPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sampled := atomic.SwapInt64(&m.bytesThisTick, 0)
+			inst := float64(sampled) / m.tickPeriod.Seconds()
+
+			m.mutex.Lock()
+			m.instRate = inst
+			m.avgRate = m.alpha*inst + (1-m.alpha)*m.avgRate
+			if m.avgRate > m.peakRate {
+				m.peakRate = m.avgRate
+			}
+			m.mutex.Unlock()
+		case <-m.closeChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrDocumentNotExist is returned by a DocumentStore when a Fetch targets an
+// id that isn't present.
+var ErrDocumentNotExist = errors.New("document does not exist in store")
+
+// DocumentStore is the interface by which a Binder persists and retrieves
+// the Document it is responsible for. Implementations are free to choose
+// their own backing mechanism (memory, disk, a remote service, etc), the
+// Binder only needs to be able to Fetch a Document by id and Store the
+// latest version of it.
+type DocumentStore interface {
+	Fetch(id string) (*Document, error)
+	Store(doc *Document) error
+}
+
+// MemoryStore is a DocumentStore implementation that keeps documents
+// in-process. It is useful for tests and for single-node deployments where
+// persistence across restarts isn't required.
+type MemoryStore struct {
+	mutex     sync.Mutex
+	documents map[string]*Document
+}
+
+// Fetch attempts to retrieve a document by its id.
+func (m *MemoryStore) Fetch(id string) (*Document, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.documents == nil {
+		return nil, ErrDocumentNotExist
+	}
+	doc, ok := m.documents[id]
+	if !ok {
+		return nil, ErrDocumentNotExist
+	}
+	return doc, nil
+}
+
+// Store saves a document, overwriting any previous version held for its id.
+func (m *MemoryStore) Store(doc *Document) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.documents == nil {
+		m.documents = map[string]*Document{}
+	}
+	m.documents[doc.ID] = doc
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	zipkinot "github.com/openzipkin-contrib/zipkin-go-opentracing"
+	jaeger "github.com/uber/jaeger-client-go"
+	jaegercfg "github.com/uber/jaeger-client-go/config"
+)
+
+// TracingConfig holds the options needed to build an opentracing.Tracer for
+// a Binder. An empty CollectorType yields a no-op tracer, suitable for
+// single-node deployments that don't need cluster-wide traces.
+type TracingConfig struct {
+	// CollectorType selects the exporter: "zipkin", "jaeger", or "" (no-op).
+	CollectorType string `json:"collector_type"`
+
+	// ConnectString is the exporter-specific endpoint, e.g. a Zipkin HTTP
+	// collector URL or a Jaeger agent host:port.
+	ConnectString string `json:"connect_string"`
+
+	// ServiceName identifies this leaps server in the resulting traces.
+	ServiceName string `json:"service_name"`
+
+	// SamplerRate is the fraction (0.0-1.0) of traces to sample.
+	SamplerRate float64 `json:"sampler_rate"`
+}
+
+// DefaultTracingConfig returns a TracingConfig that builds a no-op tracer.
+func DefaultTracingConfig() TracingConfig {
+	return TracingConfig{
+		ServiceName: "leaps",
+		SamplerRate: 1.0,
+	}
+}
+
+// CreateTracer builds an opentracing.Tracer from a TracingConfig, along with
+// an io.Closer that should be closed when the owning Binder is done with it.
+func CreateTracer(config TracingConfig) (opentracing.Tracer, io.Closer, error) {
+	switch config.CollectorType {
+	case "":
+		return opentracing.NoopTracer{}, ioutil.NopCloser(nil), nil
+	case "zipkin":
+		reporter := zipkinhttp.NewReporter(config.ConnectString)
+
+		endpoint, err := zipkin.NewEndpoint(config.ServiceName, "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create zipkin endpoint: %v", err)
+		}
+
+		sampler, err := zipkin.NewBoundarySampler(config.SamplerRate, 0)
+		if err != nil {
+			reporter.Close()
+			return nil, nil, fmt.Errorf("failed to create zipkin sampler: %v", err)
+		}
+
+		tracer, err := zipkin.NewTracer(
+			reporter,
+			zipkin.WithLocalEndpoint(endpoint),
+			zipkin.WithSampler(sampler),
+		)
+		if err != nil {
+			reporter.Close()
+			return nil, nil, fmt.Errorf("failed to create zipkin tracer: %v", err)
+		}
+		return zipkinot.Wrap(tracer), reporter, nil
+	case "jaeger":
+		cfg := jaegercfg.Configuration{
+			ServiceName: config.ServiceName,
+			Sampler: &jaegercfg.SamplerConfig{
+				Type:  jaeger.SamplerTypeProbabilistic,
+				Param: config.SamplerRate,
+			},
+			Reporter: &jaegercfg.ReporterConfig{
+				LocalAgentHostPort: config.ConnectString,
+			},
+		}
+		tracer, closer, err := cfg.NewTracer()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create jaeger tracer: %v", err)
+		}
+		return tracer, closer, nil
+	}
+	return nil, nil, fmt.Errorf("unrecognised tracer collector type: %v", config.CollectorType)
+}
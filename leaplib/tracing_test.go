@@ -0,0 +1,133 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+// TestBinderStoriesSpanTree drives the same story fixtures as
+// TestBinderStories but with a mock tracer installed, and asserts that the
+// expected span tree (one subscribe span for its single client, a
+// send_transform/apply_transform pair per submitted transform with each
+// apply_transform a child of a send_transform, and at least one flush span)
+// is produced.
+func TestBinderStoriesSpanTree(t *testing.T) {
+	logConf := DefaultLoggerConfig()
+	logConf.LogLevel = LeapError
+	logger := CreateLogger(logConf)
+
+	bytes, err := ioutil.ReadFile("../data/binder_stories.js")
+	if err != nil {
+		t.Fatalf("Read file error: %v", err)
+	}
+
+	var scont binderStoriesContainer
+	if err := json.Unmarshal(bytes, &scont); err != nil {
+		t.Fatalf("Story parse error: %v", err)
+	}
+
+	for i, story := range scont.Stories {
+		tracer := mocktracer.New()
+
+		doc, err := CreateNewDocument(fmt.Sprintf("story%v", i), "testing", "text", story.Content)
+		if err != nil {
+			t.Errorf("error: %v", err)
+			continue
+		}
+
+		config := DefaultBinderConfig()
+		config.Tracer = tracer
+
+		errChan := make(chan BinderError)
+		go func() {
+			for err := range errChan {
+				t.Errorf("From error channel: %v", err.Err)
+			}
+		}()
+
+		binder, err := BindNew(doc, &MemoryStore{documents: map[string]*Document{}}, config, errChan, logger)
+		if err != nil {
+			t.Errorf("error: %v", err)
+			continue
+		}
+
+		bp := binder.Subscribe()
+		go func() {
+			for range bp.TransformRcvChan {
+			}
+		}()
+
+		for j := 0; j < len(story.Transforms); j++ {
+			if _, err = bp.SendTransform(story.Transforms[j], time.Second); err != nil {
+				t.Errorf("Send issue %v", err)
+			}
+		}
+
+		binder.Close()
+
+		spans := tracer.FinishedSpans()
+
+		counts := map[string]int{}
+		for _, s := range spans {
+			counts[s.OperationName]++
+		}
+
+		if counts["subscribe"] != 1 {
+			t.Errorf("story %v: expected 1 subscribe span, got %v", i, counts["subscribe"])
+		}
+		if exp := len(story.Transforms); counts["send_transform"] != exp {
+			t.Errorf("story %v: expected %v send_transform spans, got %v", i, exp, counts["send_transform"])
+		}
+		if exp := len(story.Transforms); counts["apply_transform"] != exp {
+			t.Errorf("story %v: expected %v apply_transform spans, got %v", i, exp, counts["apply_transform"])
+		}
+		if counts["flush"] < 1 {
+			t.Errorf("story %v: expected at least 1 flush span, got %v", i, counts["flush"])
+		}
+
+		for _, s := range spans {
+			if s.OperationName == "apply_transform" {
+				parent := findSpan(spans, s.ParentID)
+				if parent == nil || parent.OperationName != "send_transform" {
+					t.Errorf("story %v: apply_transform span should be a child of send_transform", i)
+				}
+			}
+		}
+	}
+}
+
+func findSpan(spans []*mocktracer.MockSpan, id int) *mocktracer.MockSpan {
+	for _, s := range spans {
+		if s.SpanContext.SpanID == id {
+			return s
+		}
+	}
+	return nil
+}
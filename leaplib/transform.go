@@ -0,0 +1,102 @@
+/*
+Copyright (c) 2014 Ashley Jeffs
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package leaplib
+
+// OTransform is an operational transform against a document's plain text
+// content: delete n runes from Position and then insert Insert at Position.
+// Version is the document version the transform produces when no concurrent
+// transform beats it, i.e. one more than the version it was generated
+// against; the binder uses it to
+// work out how many concurrent transforms it needs to be shifted across
+// before it can be applied.
+type OTransform struct {
+	Position int    `json:"position"`
+	Version  int    `json:"version"`
+	Delete   int    `json:"delete"`
+	Insert   string `json:"insert"`
+
+	// SpanContext carries an injected opentracing.SpanContext so that a
+	// span started by the client that generated this transform can be
+	// joined by the server span that applies it, rather than the two
+	// traces being disconnected. Left nil/empty when tracing isn't in
+	// use.
+	SpanContext map[string]string `json:"span_context,omitempty"`
+}
+
+// Apply applies an OTransform to a string, returning the result.
+func (o OTransform) Apply(content string) string {
+	runes := []rune(content)
+	pos := o.Position
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > len(runes) {
+		pos = len(runes)
+	}
+	end := pos + o.Delete
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	result := make([]rune, 0, len(runes)-(end-pos)+len([]rune(o.Insert)))
+	result = append(result, runes[:pos]...)
+	result = append(result, []rune(o.Insert)...)
+	result = append(result, runes[end:]...)
+	return string(result)
+}
+
+// transformRanks shifts tform's Position so that it can be applied after
+// against has already been applied to the same base content. against is
+// assumed to have already happened first. Only Position is adjusted:
+// tform's Delete count is left as is, so a deletion overlapping against's
+// own edit is not trimmed.
+func transformRanks(tform, against OTransform) OTransform {
+	result := tform
+
+	insertLen := len([]rune(against.Insert))
+
+	if against.Delete > 0 && against.Position < tform.Position {
+		overlap := tform.Position - against.Position
+		if overlap > against.Delete {
+			overlap = against.Delete
+		}
+		result.Position -= overlap
+	}
+	if insertLen > 0 && against.Position <= tform.Position {
+		result.Position += insertLen
+	}
+
+	return result
+}
+
+// TransformAgainstHistory takes a transform and a history of transforms that
+// have already been applied since the base version the incoming transform
+// was generated against, and returns a corrected transform that can be
+// applied cleanly to the current content.
+func TransformAgainstHistory(tform OTransform, history []OTransform) OTransform {
+	result := tform
+	for _, h := range history {
+		result = transformRanks(result, h)
+	}
+	return result
+}